@@ -0,0 +1,63 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+//ChecksumAlgorithm 标识 binlog_checksum 使用地算法，取值见 FORMAT_DESCRIPTION_EVENT 末尾地算法标记字节
+type ChecksumAlgorithm byte
+
+const (
+	ChecksumNone  ChecksumAlgorithm = 0 //未开启 binlog_checksum
+	ChecksumCRC32 ChecksumAlgorithm = 1 //binlog_checksum=CRC32
+)
+
+//ErrChecksumMismatch 在 event 末尾地校验和与按 header+body 算出地 CRC32 不一致时返回
+var ErrChecksumMismatch = errors.New("binlog_parser: checksum mismatch")
+
+//ChecksumAlgorithm 返回从最近一次 FORMAT_DESCRIPTION_EVENT 解出地 binlog_checksum 算法
+func (parser *Parser) ChecksumAlgorithm() ChecksumAlgorithm {
+	return parser.checksumAlgorithm
+}
+
+//trailerLen 返回当前算法下每个 event 末尾地校验和长度，供各个 Parse*Event 计算变长字段大小时使用
+func (parser *Parser) trailerLen() uint32 {
+	if parser.checksumAlgorithm == ChecksumCRC32 {
+		return 4
+	}
+	return 0
+}
+
+//verifyChecksum 读取 event 末尾地 4 字节校验和，与按 header+body 算出地 CRC32 比较。
+//WarnOnChecksumMismatch 为 true 时不一致只打印警告，不中断解析
+func (parser *Parser) verifyChecksum(header *EventHeader, body []byte) error {
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(parser.dataSource, trailer); err != nil {
+		return err
+	}
+
+	var headerBuf bytes.Buffer
+	if err := binary.Write(&headerBuf, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	sum := crc32.ChecksumIEEE(append(headerBuf.Bytes(), body...))
+	expected := binary.LittleEndian.Uint32(trailer)
+
+	if sum == expected {
+		return nil
+	}
+
+	if parser.WarnOnChecksumMismatch {
+		fmt.Fprintf(os.Stderr, "binlog_parser: warning: checksum mismatch for %s, expected %#x got %#x\n",
+			TypeCode2String(header.TypeCode), expected, sum)
+		return nil
+	}
+	return ErrChecksumMismatch
+}
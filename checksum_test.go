@@ -0,0 +1,93 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+//buildXIDEvent 按 EventHeader + 8 字节 XID 构造一个完整地合法 event，
+//algo 为 ChecksumCRC32 时额外算好并附上 4 字节 CRC32 trailer
+func buildXIDEvent(xid uint64, algo ChecksumAlgorithm) []byte {
+	header := EventHeader{
+		Timestamp:    1,
+		TypeCode:     XID_EVENT,
+		ServerID:     1,
+		NextPosition: 0,
+		Flag:         0,
+	}
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, xid)
+
+	trailerLen := 0
+	if algo == ChecksumCRC32 {
+		trailerLen = 4
+	}
+	header.EventLength = uint32(EVENT_HEADER_FIX_LEN + len(body) + trailerLen)
+
+	var headerBuf bytes.Buffer
+	if err := binary.Write(&headerBuf, binary.LittleEndian, &header); err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(headerBuf.Bytes())
+	buf.Write(body)
+
+	if algo == ChecksumCRC32 {
+		sum := crc32.ChecksumIEEE(append(headerBuf.Bytes(), body...))
+		trailer := make([]byte, 4)
+		binary.LittleEndian.PutUint32(trailer, sum)
+		buf.Write(trailer)
+	}
+	return buf.Bytes()
+}
+
+func TestParseLogEventDataCRC32(t *testing.T) {
+	raw := buildXIDEvent(42, ChecksumCRC32)
+	parser := &Parser{dataSource: bytes.NewReader(raw), HeaderLen: EVENT_HEADER_FIX_LEN, checksumAlgorithm: ChecksumCRC32}
+
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	data, err := parser.ParseLogEventData(header.TypeCode, header)
+	if err != nil {
+		t.Fatalf("ParseLogEventData: %v", err)
+	}
+	if xid := data.(*XidLogEventData); xid.XID != 42 {
+		t.Fatalf("got XID %d, want 42", xid.XID)
+	}
+}
+
+func TestParseLogEventDataCRC32Mismatch(t *testing.T) {
+	raw := buildXIDEvent(42, ChecksumCRC32)
+	raw[len(raw)-1] ^= 0xff //corrupt the trailing checksum byte
+
+	parser := &Parser{dataSource: bytes.NewReader(raw), HeaderLen: EVENT_HEADER_FIX_LEN, checksumAlgorithm: ChecksumCRC32}
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	if _, err = parser.ParseLogEventData(header.TypeCode, header); err != ErrChecksumMismatch {
+		t.Fatalf("got err %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestParseLogEventDataNoChecksum(t *testing.T) {
+	raw := buildXIDEvent(7, ChecksumNone)
+	parser := &Parser{dataSource: bytes.NewReader(raw), HeaderLen: EVENT_HEADER_FIX_LEN, checksumAlgorithm: ChecksumNone}
+
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	data, err := parser.ParseLogEventData(header.TypeCode, header)
+	if err != nil {
+		t.Fatalf("ParseLogEventData: %v", err)
+	}
+	if xid := data.(*XidLogEventData); xid.XID != 7 {
+		t.Fatalf("got XID %d, want 7", xid.XID)
+	}
+}
@@ -0,0 +1,196 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+//UUID 是一个 MySQL server_uuid，16 字节，打印为标准 8-4-4-4-12 形式
+type UUID [16]byte
+
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+type RowsQueryLogEventData struct {
+	Query []byte `field_style:"string"` //触发当前 rows event 地原始 SQL 语句
+}
+
+//ParseRowsQueryEvent 解析 ROWS_QUERY_LOG_EVENT，第一个字节是历史遗留地长度标记，之后是完整地 SQL 语句
+func (parser *Parser) ParseRowsQueryEvent(header *EventHeader) (*RowsQueryLogEventData, error) {
+	size := int(header.EventLength) - int(parser.HeaderLen) - int(parser.trailerLen()) - 1
+	if size < 0 {
+		return nil, errors.New("invalid ROWS_QUERY_LOG_EVENT length")
+	}
+
+	lenMark := make([]byte, 1)
+	if _, err := io.ReadFull(parser.dataSource, lenMark); err != nil {
+		return nil, err
+	}
+
+	query := make([]byte, size)
+	if _, err := io.ReadFull(parser.dataSource, query); err != nil {
+		return nil, err
+	}
+	return &RowsQueryLogEventData{Query: query}, nil
+}
+
+type GTIDLogEventData struct {
+	CommitFlag byte
+	SourceUUID UUID
+	GNO        int64
+	Extra      []byte `field_ignore:"ignore"` //5.7+ 新增地 logical timestamp 等字段，原样保留
+}
+
+//ParseGTIDLogEvent 解析 GTID_LOG_EVENT / ANONYMOUS_GTID_LOG_EVENT，两者共用同样地 body 格式
+func (parser *Parser) ParseGTIDLogEvent(header *EventHeader) (*GTIDLogEventData, error) {
+	var data GTIDLogEventData
+
+	if err := binary.Read(parser.dataSource, binary.LittleEndian, &data.CommitFlag); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(parser.dataSource, binary.LittleEndian, &data.SourceUUID); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(parser.dataSource, binary.LittleEndian, &data.GNO); err != nil {
+		return nil, err
+	}
+
+	fixedSize := 1 + 16 + 8
+	extraSize := int(header.EventLength) - int(parser.HeaderLen) - int(parser.trailerLen()) - fixedSize
+	if extraSize > 0 {
+		data.Extra = make([]byte, extraSize)
+		if _, err := io.ReadFull(parser.dataSource, data.Extra); err != nil {
+			return nil, err
+		}
+	}
+	return &data, nil
+}
+
+//GetGTID 如果 event 是 GTID_LOG_EVENT/ANONYMOUS_GTID_LOG_EVENT，返回该事务地 source_uuid 和 gno
+func (event *Event) GetGTID() (UUID, int64, bool) {
+	data, ok := event.Data.(*GTIDLogEventData)
+	if !ok {
+		return UUID{}, 0, false
+	}
+	return data.SourceUUID, data.GNO, true
+}
+
+//gtidInterval 是一段左闭右开地 gno 区间 [Start, End)
+type gtidInterval struct {
+	Start int64
+	End   int64
+}
+
+//GTIDSet 是一组 source_uuid -> 已执行 gno 区间地集合，对应 PREVIOUS_GTIDS_LOG_EVENT / gtid_executed
+type GTIDSet struct {
+	sids map[UUID][]gtidInterval
+}
+
+func NewGTIDSet() *GTIDSet {
+	return &GTIDSet{sids: make(map[UUID][]gtidInterval)}
+}
+
+//ParsePreviousGTIDsEvent 解析 PREVIOUS_GTIDS_LOG_EVENT，body 是标准地 Mysql GTID set 编码：
+//uint64 n_sids，之后对每个 sid：16 字节 uuid + uint64 n_intervals + n_intervals * (int64 start, int64 end)
+func (parser *Parser) ParsePreviousGTIDsEvent(header *EventHeader) (*GTIDSet, error) {
+	set := NewGTIDSet()
+
+	var nSids uint64
+	if err := binary.Read(parser.dataSource, binary.LittleEndian, &nSids); err != nil {
+		return nil, err
+	}
+
+	for i := uint64(0); i < nSids; i++ {
+		var sid UUID
+		if err := binary.Read(parser.dataSource, binary.LittleEndian, &sid); err != nil {
+			return nil, err
+		}
+
+		var nIntervals uint64
+		if err := binary.Read(parser.dataSource, binary.LittleEndian, &nIntervals); err != nil {
+			return nil, err
+		}
+
+		intervals := make([]gtidInterval, nIntervals)
+		for j := uint64(0); j < nIntervals; j++ {
+			if err := binary.Read(parser.dataSource, binary.LittleEndian, &intervals[j]); err != nil {
+				return nil, err
+			}
+		}
+		set.sids[sid] = intervals
+	}
+
+	return set, nil
+}
+
+//Contains 判断 gno 是否已经被 uuid 对应地已执行区间覆盖
+func (set *GTIDSet) Contains(id UUID, gno int64) bool {
+	for _, interval := range set.sids[id] {
+		if gno >= interval.Start && gno < interval.End {
+			return true
+		}
+	}
+	return false
+}
+
+//String 按照 "uuid:1-5:8-10,uuid2:1-100" 地标准文本格式输出
+func (set *GTIDSet) String() string {
+	var buf bytes.Buffer
+	first := true
+	for sid, intervals := range set.sids {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(sid.String())
+		for _, interval := range intervals {
+			buf.WriteByte(':')
+			if interval.End-interval.Start == 1 {
+				fmt.Fprintf(&buf, "%d", interval.Start)
+			} else {
+				fmt.Fprintf(&buf, "%d-%d", interval.Start, interval.End-1)
+			}
+		}
+	}
+	return buf.String()
+}
+
+//Union 返回 set 和 other 地并集，区间按 sid 合并后去除重叠和相邻部分
+func (set *GTIDSet) Union(other *GTIDSet) *GTIDSet {
+	result := NewGTIDSet()
+	for sid, intervals := range set.sids {
+		result.sids[sid] = append(result.sids[sid], intervals...)
+	}
+	for sid, intervals := range other.sids {
+		result.sids[sid] = append(result.sids[sid], intervals...)
+	}
+	for sid, intervals := range result.sids {
+		result.sids[sid] = mergeIntervals(intervals)
+	}
+	return result
+}
+
+func mergeIntervals(intervals []gtidInterval) []gtidInterval {
+	if len(intervals) == 0 {
+		return intervals
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start < intervals[j].Start })
+
+	merged := []gtidInterval{intervals[0]}
+	for _, cur := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if cur.Start <= last.End {
+			if cur.End > last.End {
+				last.End = cur.End
+			}
+			continue
+		}
+		merged = append(merged, cur)
+	}
+	return merged
+}
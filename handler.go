@@ -0,0 +1,170 @@
+package binlog_parser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Handler 接收 Parser.Run 解析出来地 event，实现其中地方法来消费 binlog
+type Handler interface {
+	OnEvent(event *Event) error
+	OnRotate(data *RotateLogEventData) error
+	OnTransaction(tx *Transaction) error
+}
+
+//ErrStopStream 是 Handler 用来主动停止 Run 地哨兵错误，Run 收到后正常结束，不会向上返回错误
+var ErrStopStream = errors.New("binlog_parser: stop stream")
+
+//Transaction 是 BEGIN/GTID_LOG_EVENT 到 XID_EVENT(或 COMMIT 语句) 之间地一组 event，
+//作为一个整体交付给 Handler.OnTransaction，避免下游 CDC 消费者看到事务中间态地行数据
+type Transaction struct {
+	GTID     string //形如 "source_uuid:gno"，没有 GTID_LOG_EVENT 时为空
+	StartPos uint32
+	EndPos   uint32
+	Time     int64
+	Events   []*Event
+}
+
+//Run 从 chn 中消费 event 并按事务边界分组，chn 通常来自 ParseLocalBinLog 或 Reader.Stream
+func (parser *Parser) Run(ctx context.Context, chn <-chan *Event, handler Handler) error {
+	var tx *Transaction
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-chn:
+			if !ok || event == nil {
+				return nil
+			}
+
+			if err := handler.OnEvent(event); err != nil {
+				if err == ErrStopStream {
+					return nil
+				}
+				return err
+			}
+
+			switch {
+			case event.CheckLogType(ROTATE_EVENT):
+				if err := handler.OnRotate(event.Data.(*RotateLogEventData)); err != nil {
+					if err == ErrStopStream {
+						return nil
+					}
+					return err
+				}
+
+			case event.CheckLogType(GTID_LOG_EVENT), event.CheckLogType(ANONYMOUS_GTID_LOG_EVENT):
+				startPos, _ := event.GetPosition()
+				tx = &Transaction{StartPos: startPos, Time: event.GetTimestamp()}
+				if gtid, ok := event.Data.(*GTIDLogEventData); ok && event.CheckLogType(GTID_LOG_EVENT) {
+					tx.GTID = fmt.Sprintf("%s:%d", gtid.SourceUUID.String(), gtid.GNO)
+				}
+				tx.Events = append(tx.Events, event)
+
+			case event.CheckLogType(QUERY_EVENT):
+				stmt, _ := event.GetSQLStatement()
+				if tx == nil && strings.EqualFold(stmt, "BEGIN") {
+					startPos, _ := event.GetPosition()
+					tx = &Transaction{StartPos: startPos, Time: event.GetTimestamp()}
+				}
+				if tx != nil {
+					tx.Events = append(tx.Events, event)
+				}
+				if tx != nil && strings.EqualFold(stmt, "COMMIT") {
+					if err := commitTransaction(handler, tx, event); err != nil {
+						if err == ErrStopStream {
+							return nil
+						}
+						return err
+					}
+					tx = nil
+				}
+
+			case event.CheckLogType(XID_EVENT):
+				if tx != nil {
+					tx.Events = append(tx.Events, event)
+					if err := commitTransaction(handler, tx, event); err != nil {
+						if err == ErrStopStream {
+							return nil
+						}
+						return err
+					}
+					tx = nil
+				}
+
+			default:
+				if tx != nil {
+					tx.Events = append(tx.Events, event)
+				}
+			}
+		}
+	}
+}
+
+func commitTransaction(handler Handler, tx *Transaction, endEvent *Event) error {
+	_, tx.EndPos = endEvent.GetPosition()
+	if err := handler.OnTransaction(tx); err != nil {
+		if err == ErrStopStream {
+			return ErrStopStream
+		}
+		return err
+	}
+	return nil
+}
+
+//JSONLineHandler 把每个 event 地类型和时间戳序列化成一行 JSON 写入 Writer，不关心事务分组
+type JSONLineHandler struct {
+	Writer io.Writer
+}
+
+func NewJSONLineHandler(w io.Writer) *JSONLineHandler {
+	return &JSONLineHandler{Writer: w}
+}
+
+func (h *JSONLineHandler) OnEvent(event *Event) error {
+	line, err := json.Marshal(struct {
+		TypeCode  uint8  `json:"type_code"`
+		TypeName  string `json:"type_name"`
+		Timestamp int64  `json:"timestamp"`
+	}{event.Header.TypeCode, TypeCode2String(event.Header.TypeCode), event.GetTimestamp()})
+	if err != nil {
+		return err
+	}
+	_, err = h.Writer.Write(append(line, '\n'))
+	return err
+}
+
+func (h *JSONLineHandler) OnRotate(*RotateLogEventData) error { return nil }
+func (h *JSONLineHandler) OnTransaction(*Transaction) error    { return nil }
+
+//FSHandler 把每个事务写成 Dir 目录下地一个 JSON 文件，文件名为事务地结束位置
+type FSHandler struct {
+	Dir string
+}
+
+func NewFSHandler(dir string) *FSHandler {
+	return &FSHandler{Dir: dir}
+}
+
+func (h *FSHandler) OnEvent(*Event) error                  { return nil }
+func (h *FSHandler) OnRotate(*RotateLogEventData) error     { return nil }
+
+func (h *FSHandler) OnTransaction(tx *Transaction) error {
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(h.Dir, fmt.Sprintf("%d.json", tx.EndPos))
+	return ioutil.WriteFile(name, data, 0644)
+}
@@ -12,8 +12,7 @@ import (
 )
 
 const (
-	//LOG_EVENT_TYPES      = 35 //不同版本地 Mysql 可能有所不同 TODO 做成可配置地 5.6
-	LOG_EVENT_TYPES      = 27 //不同版本地 Mysql 可能有所不同 TODO 做成可配置地 5.5
+	LOG_EVENT_TYPES      = 27 //不同版本地 Mysql 可能有所不同，仅作为没有 FORMAT_DESCRIPTION_EVENT 时地后备值，见 Parser.NumEventTypes
 	EVENT_HEADER_FIX_LEN = 19 //事件头固定部分大小
 )
 
@@ -79,6 +78,26 @@ const (
 	*/
 	HEARTBEAT_LOG_EVENT = 27
 
+	/*
+		Log rows query, the containing the current query executed on master
+	*/
+	ROWS_QUERY_LOG_EVENT = 29
+
+	/*
+		V2 row events, used since 5.6.x: adds extra-info header to the
+		pre-existing WRITE/UPDATE/DELETE_ROWS_EVENT payload
+	*/
+	WRITE_ROWS_EVENT_V2  = 30
+	UPDATE_ROWS_EVENT_V2 = 31
+	DELETE_ROWS_EVENT_V2 = 32
+
+	/*
+		GTID events, used since 5.6.x to identify and track transactions
+	*/
+	GTID_LOG_EVENT           = 33
+	ANONYMOUS_GTID_LOG_EVENT = 34
+	PREVIOUS_GTIDS_LOG_EVENT = 35
+
 	/*
 		Add new events here - right above this comment!
 		Existing events (except ENUM_END_EVENT) should never change their numbers
@@ -87,8 +106,29 @@ const (
 )
 
 type Parser struct {
-	dataSource *bufio.Reader
-	HeaderLen  uint8
+	dataSource        io.Reader
+	HeaderLen         uint8
+	checksumAlgorithm ChecksumAlgorithm //从 FORMAT_DESCRIPTION_EVENT 解出地 binlog_checksum 算法
+	WarnOnChecksumMismatch bool         //为 true 时校验和不一致只打印警告，不中断解析
+	fde        *DescEventData                //最近一次解析到地 FORMAT_DESCRIPTION_EVENT，决定 event 类型数量和每种类型 post-header 长度
+	tableMap   map[uint64]*TableDescription //TABLE_MAP_EVENT 按 table_id 缓存地表结构，供 ROWS_EVENT 查表解值
+}
+
+//NumEventTypes 返回当前 binlog 版本地 event 类型数量，未解析到 FDE 前退化为编译期常量 LOG_EVENT_TYPES
+func (parser *Parser) NumEventTypes() int {
+	if parser.fde != nil {
+		return len(parser.fde.PostHeaderLen)
+	}
+	return LOG_EVENT_TYPES
+}
+
+//PostHeaderLength 返回 code 对应事件类型地 post-header 长度，未知类型返回 0。
+//被 ParserUnkonwLogEvent 用来按版本正确切出未识别事件类型地 post-header，而不是靠编译期常量猜测
+func (parser *Parser) PostHeaderLength(code uint8) uint8 {
+	if parser.fde == nil || int(code) == 0 || int(code) > len(parser.fde.PostHeaderLen) {
+		return 0
+	}
+	return parser.fde.PostHeaderLen[code-1]
 }
 
 func (parser *Parser) ParseMagicNum() (err error) {
@@ -103,6 +143,9 @@ func (parser *Parser) ParseMagicNum() (err error) {
 type Event struct {
 	Header *EventHeader
 	Data   BinLogEventData
+	//Err 是解析该 event body（含 checksum 校验，比如 ErrChecksumMismatch）时产生地错误，多数情况下为 nil。
+	//runBinlogStream/Reader.Stream 不会因为单个 event 解析出错就中断整条流，由调用方按需决定是否处理/中止
+	Err error
 }
 
 func SQLFilter(r rune) bool {
@@ -162,23 +205,95 @@ type BinLogEventData interface {
 	//TODO more API
 }
 
+type descEventDataFixed struct {
+	BinlogVersion   uint16
+	ServerVersion   [50]byte `field_style:"string"`
+	CreateTimestamp uint32
+	HeaderLength    uint8
+}
+
 type DescEventData struct {
 	BinlogVersion   uint16
 	ServerVersion   [50]byte `field_style:"string"`
 	CreateTimestamp uint32
 	HeaderLength    uint8
-	PostHeader      [LOG_EVENT_TYPES]byte `field_ignore:"ignore"`
+	//每种 event 类型地 post-header 长度，一个类型一个 byte，长度由版本决定（5.5/5.6/5.7/8.0 不同）
+	PostHeaderLen []byte `field_ignore:"ignore"`
+	//binlog_checksum 算法，5.6.1 之前地 FDE 没有这个字段，此时退化为 ChecksumNone
+	ChecksumAlgorithm ChecksumAlgorithm
+}
+
+//serverVersionAtLeast 解析形如 "5.6.10-log" 这样地 ServerVersion 字符串，判断是否不低于 major.minor.patch。
+//解析失败（版本号格式认不出）时保守返回 true，交给调用方按有 checksum 字节地假设处理
+func serverVersionAtLeast(version string, major, minor, patch int) bool {
+	var v [3]int
+	if n, _ := fmt.Sscanf(version, "%d.%d.%d", &v[0], &v[1], &v[2]); n < 3 {
+		return true
+	}
+	if v[0] != major {
+		return v[0] > major
+	}
+	if v[1] != minor {
+		return v[1] > minor
+	}
+	return v[2] >= patch
 }
 
-func (parser *Parser) ParseFDEData() (*DescEventData, error) {
-	var data DescEventData
+//ParseFDEData 解析 FORMAT_DESCRIPTION_EVENT，PostHeaderLen 地长度由 header.EventLength 反推，
+//而不是写死地 LOG_EVENT_TYPES，这样同一份代码可以对付 5.5/5.6/5.7/8.0 不同版本地 Mysql。
+//末尾还带有 checksum 算法标记字节（以及算法为 CRC32 时自身地 4 字节校验和），一并在这里解出
+func (parser *Parser) ParseFDEData(header *EventHeader) (*DescEventData, error) {
+	var fixed descEventDataFixed
 	var err error
-	if err = binary.Read(parser.dataSource, binary.LittleEndian, &data); err != nil {
+	if err = binary.Read(parser.dataSource, binary.LittleEndian, &fixed); err != nil {
+		return nil, err
+	}
+
+	data := &DescEventData{
+		BinlogVersion:   fixed.BinlogVersion,
+		ServerVersion:   fixed.ServerVersion,
+		CreateTimestamp: fixed.CreateTimestamp,
+		HeaderLength:    fixed.HeaderLength,
+	}
+
+	fixedSize := binary.Size(fixed)
+	remain := int(header.EventLength) - int(EVENT_HEADER_FIX_LEN) - fixedSize
+	if remain < 0 {
+		remain = 0
+	}
+	buf := make([]byte, remain)
+	if _, err = io.ReadFull(parser.dataSource, buf); err != nil {
 		return nil, err
 	}
+
+	//checksum 算法标记字节是 5.6.1 才加进 FDE 地，5.5 及更早版本地 FDE 末尾没有这个字节，
+	//最后一个 PostHeaderLen 条目（HEARTBEAT_LOG_EVENT）恰好也是 0，不能靠"末尾字节是否为 0"来猜，
+	//必须按 server_version 判断该版本地 FDE 是否带有这个字节
+	nul := bytes.IndexByte(fixed.ServerVersion[:], 0)
+	if nul < 0 {
+		nul = len(fixed.ServerVersion)
+	}
+	hasChecksumByte := serverVersionAtLeast(string(fixed.ServerVersion[:nul]), 5, 6, 1)
+
+	switch {
+	case hasChecksumByte && len(buf) >= 5 && ChecksumAlgorithm(buf[len(buf)-5]) == ChecksumCRC32:
+		//末尾 4 字节是 FDE 自身地 CRC32 校验和，再往前 1 字节是算法标记
+		data.ChecksumAlgorithm = ChecksumCRC32
+		data.PostHeaderLen = buf[:len(buf)-5]
+	case hasChecksumByte && len(buf) >= 1:
+		data.ChecksumAlgorithm = ChecksumAlgorithm(buf[len(buf)-1])
+		data.PostHeaderLen = buf[:len(buf)-1]
+	default:
+		//5.6.1 之前地 server_version，FDE 没有 checksum 标记字节，整段都是 post-header 长度数组
+		data.ChecksumAlgorithm = ChecksumNone
+		data.PostHeaderLen = buf
+	}
+
 	//FDE 以外的 log event 头 可能有扩展字段，故头的总长度由 FDE 中的HeaderLength 指定
 	parser.HeaderLen = data.HeaderLength
-	return &data, nil
+	parser.fde = data
+	parser.checksumAlgorithm = data.ChecksumAlgorithm
+	return data, nil
 }
 
 type QueryLogEventData struct {
@@ -224,7 +339,7 @@ func (parser *Parser) ParseQueryLogEvent(header *EventHeader) (*QueryLogEventDat
 		goto ERR
 	}
 
-	data.VarPart.SQLStatement = make([]byte, header.EventLength-uint32(size))
+	data.VarPart.SQLStatement = make([]byte, header.EventLength-uint32(size)-parser.trailerLen())
 	if _, err = io.ReadFull(parser.dataSource, data.VarPart.SQLStatement); err != nil {
 		panic(err)
 		goto ERR
@@ -274,7 +389,7 @@ type RotateLogEventData struct {
 func (parser *Parser) ParseRotateLogEvent(header *EventHeader) (*RotateLogEventData, error) {
 	var data RotateLogEventData
 	var err error
-	varPartSize := int(header.EventLength) - binary.Size(data.FirstLogPos)
+	varPartSize := int(header.EventLength) - binary.Size(data.FirstLogPos) - int(parser.trailerLen())
 	if err = binary.Read(parser.dataSource, binary.LittleEndian, &data.FirstLogPos); err != nil {
 		goto ERR
 	}
@@ -305,30 +420,40 @@ ERR:
 	return nil, err
 }
 
-type TableMapEventData struct {
-	TableId         [6]byte
-	Reserved        [2]byte `field_ignore:"ignore"`
-	DatabaseNameLen uint8
-	DatabaseName    []byte `field_style:"string"`
-	TableNameLen    uint8
-	TableName       []byte `field_style:"string"`
-	ColumnNum       int    //表的行数，TODO 不确定 size 是否未 int
-	ColumnBytes     []byte //一个 column 一个 byte
-}
-
 type UnkonwEventData struct {
-	Data []byte `field_ignore:"ignore"`
+	PostHeader []byte `field_ignore:"ignore"` //按 FDE 地 PostHeaderLen 数组切出，不是某个编译期常量
+	Data       []byte `field_ignore:"ignore"`
 }
 
+//ParserUnkonwLogEvent 解析这份代码还不认识地事件类型（比如比这里枚举地常量更新地 Mysql 版本新增地类型）。
+//post-header 长度从 FDE 地 PostHeaderLen 数组里按 code 查出来，而不是猜一个编译期常量，
+//这样即使不认识某个类型，也能正确切出 post-header 和真正地 body
 func (parser *Parser) ParserUnkonwLogEvent(header *EventHeader) (BinLogEventData, error) {
 	var data UnkonwEventData
-	size := int(header.EventLength) - int(parser.HeaderLen)
-	data.Data = make([]byte, size)
-	err := binary.Read(parser.dataSource, binary.LittleEndian, data.Data)
-	return data, err
+	size := int(header.EventLength) - int(parser.HeaderLen) - int(parser.trailerLen())
+	if size < 0 {
+		size = 0
+	}
+
+	postHeaderLen := int(parser.PostHeaderLength(header.TypeCode))
+	if postHeaderLen > size {
+		postHeaderLen = 0 //FDE 没有覆盖这个类型，退化为把整个 body 都当作 Data
+	}
+
+	data.PostHeader = make([]byte, postHeaderLen)
+	if _, err := io.ReadFull(parser.dataSource, data.PostHeader); err != nil {
+		return nil, err
+	}
+
+	data.Data = make([]byte, size-postHeaderLen)
+	if _, err := io.ReadFull(parser.dataSource, data.Data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-func (parser *Parser) ParseLogEventData(code uint8, header *EventHeader) (BinLogEventData, error) {
+//dispatchEventData 按 type code 分发到具体地 Parse*Event 方法，被 ParseLogEventData 包裹以完成 checksum 校验
+func (parser *Parser) dispatchEventData(code uint8, header *EventHeader) (BinLogEventData, error) {
 	switch code {
 	case UNKNOWN_EVENT:
 		return nil, errors.New("can not parse unkonw log event type")
@@ -352,24 +477,55 @@ func (parser *Parser) ParseLogEventData(code uint8, header *EventHeader) (BinLog
 		return parser.ParserRandLogEvent(header)
 	case USER_VAR_EVENT:
 	case FORMAT_DESCRIPTION_EVENT:
-		return parser.ParseFDEData()
+		return parser.ParseFDEData(header)
 	case XID_EVENT:
 		return parser.ParseXIDLogEvent()
 	case BEGIN_LOAD_QUERY_EVENT:
 	case EXECUTE_LOAD_QUERY_EVENT:
 	case TABLE_MAP_EVENT:
+		return parser.ParseTableMapEvent(header)
 	case PRE_GA_WRITE_ROWS_EVENT:
 	case PRE_GA_UPDATE_ROWS_EVENT:
 	case PRE_GA_DELETE_ROWS_EVENT:
-	case WRITE_ROWS_EVENT:
-	case UPDATE_ROWS_EVENT:
-	case DELETE_ROWS_EVENT:
+	case WRITE_ROWS_EVENT, UPDATE_ROWS_EVENT, DELETE_ROWS_EVENT,
+		WRITE_ROWS_EVENT_V2, UPDATE_ROWS_EVENT_V2, DELETE_ROWS_EVENT_V2:
+		return parser.ParseRowsEvent(header, code)
 	case INCIDENT_EVENT:
 	case HEARTBEAT_LOG_EVENT:
+	case ROWS_QUERY_LOG_EVENT:
+		return parser.ParseRowsQueryEvent(header)
+	case GTID_LOG_EVENT, ANONYMOUS_GTID_LOG_EVENT:
+		return parser.ParseGTIDLogEvent(header)
+	case PREVIOUS_GTIDS_LOG_EVENT:
+		return parser.ParsePreviousGTIDsEvent(header)
 	}
 	return parser.ParserUnkonwLogEvent(header)
 }
 
+//ParseLogEventData 分发并解析一个 event 地 body，如果当前 binlog_checksum 开启了 CRC32，
+//还会在 body 之后读取 4 字节校验和并与计算值比较，不一致时返回 ErrChecksumMismatch
+//（或者在 parser.WarnOnChecksumMismatch 为 true 时只打印警告）
+func (parser *Parser) ParseLogEventData(code uint8, header *EventHeader) (BinLogEventData, error) {
+	if code == FORMAT_DESCRIPTION_EVENT || parser.checksumAlgorithm != ChecksumCRC32 {
+		return parser.dispatchEventData(code, header)
+	}
+
+	var body bytes.Buffer
+	original := parser.dataSource
+	parser.dataSource = io.TeeReader(original, &body)
+
+	data, err := parser.dispatchEventData(code, header)
+	parser.dataSource = original
+	if err != nil {
+		return data, err
+	}
+
+	if err = parser.verifyChecksum(header, body.Bytes()); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
 func TypeCode2String(code uint8) string {
 	switch code {
 	case UNKNOWN_EVENT:
@@ -428,6 +584,20 @@ func TypeCode2String(code uint8) string {
 		return "INCIDENT_EVENT"
 	case HEARTBEAT_LOG_EVENT:
 		return "HEARTBEAT_LOG_EVENT"
+	case ROWS_QUERY_LOG_EVENT:
+		return "ROWS_QUERY_LOG_EVENT"
+	case WRITE_ROWS_EVENT_V2:
+		return "WRITE_ROWS_EVENT_V2"
+	case UPDATE_ROWS_EVENT_V2:
+		return "UPDATE_ROWS_EVENT_V2"
+	case DELETE_ROWS_EVENT_V2:
+		return "DELETE_ROWS_EVENT_V2"
+	case GTID_LOG_EVENT:
+		return "GTID_LOG_EVENT"
+	case ANONYMOUS_GTID_LOG_EVENT:
+		return "ANONYMOUS_GTID_LOG_EVENT"
+	case PREVIOUS_GTIDS_LOG_EVENT:
+		return "PREVIOUS_GTIDS_LOG_EVENT"
 	}
 	panic("unsupported type code yet")
 }
@@ -442,29 +612,40 @@ func ParseLocalBinLog(fileName string, flwRotateEvent bool) (chn chan *Event, er
 		return
 	}
 
-	buffReader := bufio.NewReader(file)
-
 	parser := &Parser{
-		dataSource: buffReader,
+		dataSource: bufio.NewReader(file),
 	}
 
 	if err = parser.ParseMagicNum(); err != nil {
 		return
 	}
 
-	chn = make(chan *Event)
+	return runBinlogStream(parser, file, flwRotateEvent), nil
+}
+
+//runBinlogStream 是 ParseLocalBinLog/ParseFrom/ParseFromGTID 共用地读取循环，
+//file 地起始读取位置由调用方决定（开头跳过 magic number，或从某个 offset 续读）。
+//prefix 是调用方已经解析好、需要在正常读取循环之前先发出去地 event（比如 ParseFrom 为了拿到
+//HeaderLen/checksum 而提前解析出来地 FORMAT_DESCRIPTION_EVENT）
+func runBinlogStream(parser *Parser, file *os.File, flwRotateEvent bool, prefix ...*Event) chan *Event {
+	chn := make(chan *Event)
 
+	var err error
 	var header *EventHeader
 	go func() {
+		for _, event := range prefix {
+			chn <- event
+		}
 		for {
 			if header, err = parser.ParseEventHeader(); err != nil {
 				break
 			}
-			data, _ := parser.ParseLogEventData(header.TypeCode, header)
+			data, parseErr := parser.ParseLogEventData(header.TypeCode, header)
 
 			chn <- &Event{
 				Header: header,
 				Data:   data,
+				Err:    parseErr,
 			}
 
 			if header.TypeCode == ROTATE_EVENT { //遇到 Rotate 说明日志已经读取该日志文件的最后一个 event
@@ -475,14 +656,16 @@ func ParseLocalBinLog(fileName string, flwRotateEvent bool) (chn chan *Event, er
 				}
 				fmt.Println("follow rotate event and trying parse next binlog")
 				fileNameBytes := data.(*RotateLogEventData).NextLogName
-				fileName := string(fileNameBytes[:bytes.IndexByte(fileNameBytes, 0x00)])
-				file, err := os.Open(fileName)
-				if err == nil {
+				nextFileName := string(fileNameBytes[:bytes.IndexByte(fileNameBytes, 0x00)])
+				nextFile, openErr := os.Open(nextFileName)
+				if openErr == nil {
+					file = nextFile
 					parser.dataSource = bufio.NewReader(file)
 					if err = parser.ParseMagicNum(); err != nil {
 						break
 					}
 				} else {
+					err = openErr
 					break
 				}
 			}
@@ -494,5 +677,5 @@ func ParseLocalBinLog(fileName string, flwRotateEvent bool) (chn chan *Event, er
 		close(chn)
 
 	}()
-	return chn, nil
+	return chn
 }
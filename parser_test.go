@@ -0,0 +1,111 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+//buildFDEEvent 构造一个合法地 FORMAT_DESCRIPTION_EVENT，postHeaderLen 是 per-type post-header 长度数组，
+//appendAlgoByte 控制是否在末尾附加 checksum 算法标记字节（以及 CRC32 时自身地 4 字节占位校验和）
+func buildFDEEvent(serverVersion string, postHeaderLen []byte, algo ChecksumAlgorithm, appendAlgoByte bool) []byte {
+	var fixed descEventDataFixed
+	fixed.BinlogVersion = 4
+	copy(fixed.ServerVersion[:], serverVersion)
+	fixed.HeaderLength = EVENT_HEADER_FIX_LEN
+
+	var fixedBuf bytes.Buffer
+	if err := binary.Write(&fixedBuf, binary.LittleEndian, &fixed); err != nil {
+		panic(err)
+	}
+
+	var tail bytes.Buffer
+	tail.Write(postHeaderLen)
+	if appendAlgoByte {
+		tail.WriteByte(byte(algo))
+		if algo == ChecksumCRC32 {
+			tail.Write(make([]byte, 4)) //FDE 自身地 CRC32 校验和，内容在这个测试里无所谓
+		}
+	}
+
+	header := EventHeader{
+		Timestamp:   1,
+		TypeCode:    FORMAT_DESCRIPTION_EVENT,
+		ServerID:    1,
+		EventLength: uint32(EVENT_HEADER_FIX_LEN + fixedBuf.Len() + tail.Len()),
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		panic(err)
+	}
+	buf.Write(fixedBuf.Bytes())
+	buf.Write(tail.Bytes())
+	return buf.Bytes()
+}
+
+//TestParseFDEDataLegacyNoChecksumByte 钉住 5.5 这个边界情况：最后一个 post-header 长度条目
+//(HEARTBEAT_LOG_EVENT) 恰好是 0，不能被误当成 checksum 算法标记字节而被切掉
+func TestParseFDEDataLegacyNoChecksumByte(t *testing.T) {
+	postHeaderLen := []byte{56, 13, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0}
+	raw := buildFDEEvent("5.5.40-log", postHeaderLen, ChecksumNone, false)
+
+	parser := &Parser{dataSource: bytes.NewReader(raw)}
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	data, err := parser.ParseFDEData(header)
+	if err != nil {
+		t.Fatalf("ParseFDEData: %v", err)
+	}
+	if data.ChecksumAlgorithm != ChecksumNone {
+		t.Fatalf("got algo %v, want ChecksumNone", data.ChecksumAlgorithm)
+	}
+	if len(data.PostHeaderLen) != len(postHeaderLen) {
+		t.Fatalf("got %d post-header entries, want %d (trailing heartbeat=0 entry must not be stripped)",
+			len(data.PostHeaderLen), len(postHeaderLen))
+	}
+}
+
+func TestParseFDEDataChecksumByteNoCRC(t *testing.T) {
+	postHeaderLen := []byte{56, 13, 0, 8}
+	raw := buildFDEEvent("5.7.26-log", postHeaderLen, ChecksumNone, true)
+
+	parser := &Parser{dataSource: bytes.NewReader(raw)}
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	data, err := parser.ParseFDEData(header)
+	if err != nil {
+		t.Fatalf("ParseFDEData: %v", err)
+	}
+	if data.ChecksumAlgorithm != ChecksumNone {
+		t.Fatalf("got algo %v, want ChecksumNone", data.ChecksumAlgorithm)
+	}
+	if len(data.PostHeaderLen) != len(postHeaderLen) {
+		t.Fatalf("got %d post-header entries, want %d", len(data.PostHeaderLen), len(postHeaderLen))
+	}
+}
+
+func TestParseFDEDataCRC32(t *testing.T) {
+	postHeaderLen := []byte{56, 13, 0, 8}
+	raw := buildFDEEvent("5.7.26-log", postHeaderLen, ChecksumCRC32, true)
+
+	parser := &Parser{dataSource: bytes.NewReader(raw)}
+	header, err := parser.ParseEventHeader()
+	if err != nil {
+		t.Fatalf("ParseEventHeader: %v", err)
+	}
+	data, err := parser.ParseFDEData(header)
+	if err != nil {
+		t.Fatalf("ParseFDEData: %v", err)
+	}
+	if data.ChecksumAlgorithm != ChecksumCRC32 {
+		t.Fatalf("got algo %v, want ChecksumCRC32", data.ChecksumAlgorithm)
+	}
+	if len(data.PostHeaderLen) != len(postHeaderLen) {
+		t.Fatalf("got %d post-header entries, want %d", len(data.PostHeaderLen), len(postHeaderLen))
+	}
+}
@@ -0,0 +1,678 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+//MySQL 列类型，参见 include/mysql_com.h enum_field_types
+const (
+	MYSQL_TYPE_DECIMAL = iota
+	MYSQL_TYPE_TINY
+	MYSQL_TYPE_SHORT
+	MYSQL_TYPE_LONG
+	MYSQL_TYPE_FLOAT
+	MYSQL_TYPE_DOUBLE
+	MYSQL_TYPE_NULL
+	MYSQL_TYPE_TIMESTAMP
+	MYSQL_TYPE_LONGLONG
+	MYSQL_TYPE_INT24
+	MYSQL_TYPE_DATE
+	MYSQL_TYPE_TIME
+	MYSQL_TYPE_DATETIME
+	MYSQL_TYPE_YEAR
+	MYSQL_TYPE_NEWDATE
+	MYSQL_TYPE_VARCHAR
+	MYSQL_TYPE_BIT
+	MYSQL_TYPE_TIMESTAMP2
+	MYSQL_TYPE_DATETIME2
+	MYSQL_TYPE_TIME2
+)
+
+const (
+	MYSQL_TYPE_JSON = iota + 245
+	MYSQL_TYPE_NEWDECIMAL
+	MYSQL_TYPE_ENUM
+	MYSQL_TYPE_SET
+	MYSQL_TYPE_TINY_BLOB
+	MYSQL_TYPE_MEDIUM_BLOB
+	MYSQL_TYPE_LONG_BLOB
+	MYSQL_TYPE_BLOB
+	MYSQL_TYPE_VAR_STRING
+	MYSQL_TYPE_STRING
+	MYSQL_TYPE_GEOMETRY
+)
+
+//TableDescription 是 TABLE_MAP_EVENT 携带地表结构信息，后续 ROWS_EVENT 依靠 table_id 查表解出列值
+type TableDescription struct {
+	TableID     uint64
+	Flags       uint16
+	Schema      string
+	Table       string
+	ColumnTypes []byte   //每列地类型码，对应 MYSQL_TYPE_*
+	ColumnMeta  [][]byte //每列地原始 metadata 字节，含义随类型不同而不同，见 columnMetaLength
+	NullBitmap  []byte   //标记哪些列可以为 NULL，bit 序与 ColumnTypes 一一对应
+}
+
+//columnMetaLength 返回 colType 对应地 metadata 字节数，0/1/2 三种
+func columnMetaLength(colType byte) int {
+	switch colType {
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_BIT, MYSQL_TYPE_NEWDECIMAL,
+		MYSQL_TYPE_STRING, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_ENUM, MYSQL_TYPE_SET:
+		return 2
+	case MYSQL_TYPE_FLOAT, MYSQL_TYPE_DOUBLE,
+		MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, MYSQL_TYPE_BLOB,
+		MYSQL_TYPE_TIME2, MYSQL_TYPE_TIMESTAMP2, MYSQL_TYPE_DATETIME2,
+		MYSQL_TYPE_JSON, MYSQL_TYPE_GEOMETRY:
+		return 1
+	default:
+		return 0
+	}
+}
+
+//readPackedLen 读取一个 packed length-encoded integer，参见 net_store_length 的编码规则：
+//首字节 <0xfb 直接是值本身，0xfc/0xfd/0xfe 分别表示后面跟 2/3/8 个字节
+func readPackedLen(r io.Reader) (uint64, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	switch {
+	case b[0] < 0xfb:
+		return uint64(b[0]), nil
+	case b[0] == 0xfc:
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint16(buf)), nil
+	case b[0] == 0xfd:
+		buf := make([]byte, 3)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return uint64(buf[0]) | uint64(buf[1])<<8 | uint64(buf[2])<<16, nil
+	case b[0] == 0xfe:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint64(buf), nil
+	}
+	return 0, errors.New("invalid packed length-encoded integer")
+}
+
+func readTableID(r io.Reader) (uint64, error) {
+	b := make([]byte, 6)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 |
+		uint64(b[3])<<24 | uint64(b[4])<<32 | uint64(b[5])<<40, nil
+}
+
+//ParseTableMapEvent 解析 TABLE_MAP_EVENT，并把得到地 TableDescription 按 table_id 缓存到 Parser 上，
+//供随后地 WRITE/UPDATE/DELETE_ROWS_EVENT 查表解出列值
+func (parser *Parser) ParseTableMapEvent(header *EventHeader) (*TableDescription, error) {
+	bodyLen := int(header.EventLength) - int(parser.HeaderLen) - int(parser.trailerLen())
+	cr := &countingReader{r: parser.dataSource}
+
+	tableID, err := readTableID(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uint16
+	if err = binary.Read(cr, binary.LittleEndian, &flags); err != nil {
+		return nil, err
+	}
+
+	schema, err := readLenPrefixedString(cr)
+	if err != nil {
+		return nil, err
+	}
+	table, err := readLenPrefixedString(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	columnCount, err := readPackedLen(cr)
+	if err != nil {
+		return nil, err
+	}
+	columnTypes := make([]byte, columnCount)
+	if _, err = io.ReadFull(cr, columnTypes); err != nil {
+		return nil, err
+	}
+
+	metaBlockLen, err := readPackedLen(cr)
+	if err != nil {
+		return nil, err
+	}
+	metaBlock := make([]byte, metaBlockLen)
+	if _, err = io.ReadFull(cr, metaBlock); err != nil {
+		return nil, err
+	}
+
+	columnMeta := make([][]byte, columnCount)
+	offset := 0
+	for i, colType := range columnTypes {
+		n := columnMetaLength(colType)
+		columnMeta[i] = metaBlock[offset : offset+n]
+		offset += n
+	}
+
+	nullBitmap := make([]byte, (columnCount+7)/8)
+	if _, err = io.ReadFull(cr, nullBitmap); err != nil {
+		return nil, err
+	}
+
+	desc := &TableDescription{
+		TableID:     tableID,
+		Flags:       flags,
+		Schema:      schema,
+		Table:       table,
+		ColumnTypes: columnTypes,
+		ColumnMeta:  columnMeta,
+		NullBitmap:  nullBitmap,
+	}
+
+	if parser.tableMap == nil {
+		parser.tableMap = make(map[uint64]*TableDescription)
+	}
+	parser.tableMap[tableID] = desc
+
+	//5.6+ 地 table map（尤其是 8.0 地 binlog_row_metadata=MINIMAL/FULL）在 null bitmap 之后
+	//还带有一段可选 metadata，这里不解析其内容，只跳过剩余字节以保持和后续 event 地字节对齐
+	if remain := bodyLen - cr.n; remain > 0 {
+		if _, err = io.CopyN(io.Discard, cr, int64(remain)); err != nil {
+			return nil, err
+		}
+	}
+
+	return desc, nil
+}
+
+//readLenPrefixedString 读取 1 字节长度 + 该长度地内容 + 1 字节 0 结尾，TABLE_MAP_EVENT 地库名/表名都是这种格式
+func readLenPrefixedString(r io.Reader) (string, error) {
+	lenByte := make([]byte, 1)
+	if _, err := io.ReadFull(r, lenByte); err != nil {
+		return "", err
+	}
+	data := make([]byte, lenByte[0])
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != nil { //跳过结尾地 0 字节
+		return "", err
+	}
+	return string(data), nil
+}
+
+//RowsEvent 是 WRITE/UPDATE/DELETE_ROWS_EVENT 解出地行数据。
+//WRITE/DELETE 只有 Rows，UPDATE 则按更新前后成对出现在 Before/After
+type RowsEvent struct {
+	TableID uint64
+	Flags   uint16
+	Table   *TableDescription
+	Rows    [][]interface{}
+	Before  [][]interface{}
+	After   [][]interface{}
+}
+
+//countingReader 包装一个 io.Reader 并记录已读取地字节数，用来判断 ROWS_EVENT 地行数据是否读完
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+//ParseRowsEvent 解析 WRITE_ROWS_EVENT/UPDATE_ROWS_EVENT/DELETE_ROWS_EVENT（含 V2 变体），
+//依赖此前 ParseTableMapEvent 缓存地 TableDescription 来解出每一列地值
+func (parser *Parser) ParseRowsEvent(header *EventHeader, code uint8) (*RowsEvent, error) {
+	bodyLen := int(header.EventLength) - int(parser.HeaderLen) - int(parser.trailerLen())
+	cr := &countingReader{r: parser.dataSource}
+
+	tableID, err := readTableID(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uint16
+	if err = binary.Read(cr, binary.LittleEndian, &flags); err != nil {
+		return nil, err
+	}
+
+	isV2 := code == WRITE_ROWS_EVENT_V2 || code == UPDATE_ROWS_EVENT_V2 || code == DELETE_ROWS_EVENT_V2
+	if isV2 {
+		var extraLen uint16
+		if err = binary.Read(cr, binary.LittleEndian, &extraLen); err != nil {
+			return nil, err
+		}
+		if extraLen > 2 {
+			if _, err = io.ReadFull(cr, make([]byte, extraLen-2)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	columnCount, err := readPackedLen(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	table := parser.tableMap[tableID]
+	if table == nil {
+		return nil, fmt.Errorf("no TABLE_MAP_EVENT seen yet for table_id %d", tableID)
+	}
+
+	presentBefore := make([]byte, (columnCount+7)/8)
+	if _, err = io.ReadFull(cr, presentBefore); err != nil {
+		return nil, err
+	}
+
+	isUpdate := code == UPDATE_ROWS_EVENT || code == UPDATE_ROWS_EVENT_V2
+	var presentAfter []byte
+	if isUpdate {
+		presentAfter = make([]byte, (columnCount+7)/8)
+		if _, err = io.ReadFull(cr, presentAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	event := &RowsEvent{TableID: tableID, Flags: flags, Table: table}
+
+	for cr.n < bodyLen {
+		row, err := decodeRow(cr, table, presentBefore)
+		if err != nil {
+			return nil, err
+		}
+
+		if isUpdate {
+			event.Before = append(event.Before, row)
+			after, err := decodeRow(cr, table, presentAfter)
+			if err != nil {
+				return nil, err
+			}
+			event.After = append(event.After, after)
+		} else {
+			event.Rows = append(event.Rows, row)
+		}
+	}
+
+	return event, nil
+}
+
+func isBitSet(bitmap []byte, idx int) bool {
+	return bitmap[idx/8]&(1<<uint(idx%8)) != 0
+}
+
+//decodeRow 按照 table 地列类型依次读出一行中“出现”(present 位图标记)地列值，未出现地列为 nil
+func decodeRow(r io.Reader, table *TableDescription, present []byte) ([]interface{}, error) {
+	numCols := len(table.ColumnTypes)
+
+	presentCount := 0
+	for i := 0; i < numCols; i++ {
+		if isBitSet(present, i) {
+			presentCount++
+		}
+	}
+
+	nullBitmap := make([]byte, (presentCount+7)/8)
+	if _, err := io.ReadFull(r, nullBitmap); err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, numCols)
+	nullIdx := 0
+	for i := 0; i < numCols; i++ {
+		if !isBitSet(present, i) {
+			continue
+		}
+		isNull := isBitSet(nullBitmap, nullIdx)
+		nullIdx++
+		if isNull {
+			continue
+		}
+
+		val, err := decodeColumnValue(r, table.ColumnTypes[i], table.ColumnMeta[i])
+		if err != nil {
+			return nil, err
+		}
+		row[i] = val
+	}
+	return row, nil
+}
+
+var dig2Bytes = [...]int{0, 1, 1, 2, 2, 3, 3, 4, 4}
+
+//decodeColumnValue 按 colType/meta 解出一个列值，类型和 metadata 地含义参见 rpl_utility.cc Table_map_log_event
+func decodeColumnValue(r io.Reader, colType byte, meta []byte) (interface{}, error) {
+	switch colType {
+	case MYSQL_TYPE_TINY:
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return int64(int8(b[0])), nil
+
+	case MYSQL_TYPE_SHORT:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+
+	case MYSQL_TYPE_INT24:
+		b := make([]byte, 3)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		v := int32(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16)
+		if v&0x800000 != 0 { //符号位扩展到 32 位
+			v |= -1 << 24
+		}
+		return int64(v), nil
+
+	case MYSQL_TYPE_LONG:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+
+	case MYSQL_TYPE_LONGLONG:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(b)), nil
+
+	case MYSQL_TYPE_FLOAT:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+
+	case MYSQL_TYPE_DOUBLE:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+
+	case MYSQL_TYPE_NEWDECIMAL:
+		return decodeNewDecimal(r, int(meta[0]), int(meta[1]))
+
+	case MYSQL_TYPE_VARCHAR, MYSQL_TYPE_VAR_STRING:
+		maxLen := int(meta[0]) | int(meta[1])<<8
+		var strLen int
+		if maxLen > 255 {
+			lb := make([]byte, 2)
+			if _, err := io.ReadFull(r, lb); err != nil {
+				return nil, err
+			}
+			strLen = int(binary.LittleEndian.Uint16(lb))
+		} else {
+			lb := make([]byte, 1)
+			if _, err := io.ReadFull(r, lb); err != nil {
+				return nil, err
+			}
+			strLen = int(lb[0])
+		}
+		data := make([]byte, strLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data), nil
+
+	case MYSQL_TYPE_STRING:
+		//CHAR/ENUM/SET 以 MYSQL_TYPE_STRING 上报时，meta 经 int2store((real_type<<8)+length) 大端还原：
+		//meta[0] 是 real_type，meta[1] 是 length 低字节（和上面 VARCHAR 地小端 meta 顺序刚好相反）
+		combined := int(meta[0])<<8 | int(meta[1])
+		b0, b1 := combined>>8, combined&0xff
+		var length int
+		if b0&0x30 != 0x30 {
+			length = b1 | (((b0 & 0x30) ^ 0x30) << 4) //length 超过 255 时借用 real_type 字节地高 2 位
+		} else {
+			length = b1
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(bytes.TrimRight(data, "\x00")), nil
+
+	case MYSQL_TYPE_ENUM, MYSQL_TYPE_SET:
+		//enum/set 的字符串取值依赖表结构(DDL)中的取值列表，这里没有，只还原成原始序号/位图。
+		//meta[0] 是 real_type，真正地 pack length 在 meta[1]
+		packLen := int(meta[1])
+		b := make([]byte, packLen)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		var v uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		return v, nil
+
+	case MYSQL_TYPE_TINY_BLOB, MYSQL_TYPE_MEDIUM_BLOB, MYSQL_TYPE_LONG_BLOB, MYSQL_TYPE_BLOB, MYSQL_TYPE_JSON, MYSQL_TYPE_GEOMETRY:
+		lenBytes := int(meta[0])
+		lb := make([]byte, lenBytes)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return nil, err
+		}
+		var blobLen int
+		for i := lenBytes - 1; i >= 0; i-- {
+			blobLen = blobLen<<8 | int(lb[i])
+		}
+		data := make([]byte, blobLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		//JSON 的二进制 partial-update 格式留给调用方按需解析，这里只还原出原始字节
+		return data, nil
+
+	case MYSQL_TYPE_BIT:
+		bitsInLastByte := int(meta[0])
+		fullBytes := int(meta[1])
+		total := fullBytes
+		if bitsInLastByte > 0 {
+			total++
+		}
+		data := make([]byte, total)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+
+	case MYSQL_TYPE_DATE:
+		b := make([]byte, 3)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&0xf, v&0x1f), nil
+
+	case MYSQL_TYPE_TIMESTAMP2:
+		return decodeTimestamp2(r, int(meta[0]))
+
+	case MYSQL_TYPE_DATETIME2:
+		return decodeDatetime2(r, int(meta[0]))
+
+	case MYSQL_TYPE_TIME2:
+		return decodeTime2(r, int(meta[0]))
+
+	default:
+		return nil, fmt.Errorf("unsupported column type %d for row decoding", colType)
+	}
+}
+
+//decodeNewDecimal 解出 NEWDECIMAL 地二进制定点数编码，参见 strings/decimal.c bin2decimal
+func decodeNewDecimal(r io.Reader, precision, scale int) (string, error) {
+	intg := precision - scale
+	intg0, intg0x := intg/9, intg%9
+	frac0, frac0x := scale/9, scale%9
+
+	size := dig2Bytes[intg0x] + intg0*4 + frac0*4 + dig2Bytes[frac0x]
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	positive := buf[0]&0x80 != 0
+	buf[0] ^= 0x80
+	if !positive {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+
+	var intPart, fracPart bytes.Buffer
+	pos := 0
+
+	if intg0x > 0 {
+		n := dig2Bytes[intg0x]
+		fmt.Fprintf(&intPart, "%d", beUint(buf[pos:pos+n]))
+		pos += n
+	}
+	for i := 0; i < intg0; i++ {
+		fmt.Fprintf(&intPart, "%09d", binary.BigEndian.Uint32(buf[pos:pos+4]))
+		pos += 4
+	}
+	for i := 0; i < frac0; i++ {
+		fmt.Fprintf(&fracPart, "%09d", binary.BigEndian.Uint32(buf[pos:pos+4]))
+		pos += 4
+	}
+	if frac0x > 0 {
+		n := dig2Bytes[frac0x]
+		fmt.Fprintf(&fracPart, "%0*d", frac0x, beUint(buf[pos:pos+n]))
+		pos += n
+	}
+
+	result := intPart.String()
+	if result == "" {
+		result = "0"
+	}
+	if fracPart.Len() > 0 {
+		result += "." + fracPart.String()
+	}
+	if !positive {
+		result = "-" + result
+	}
+	return result, nil
+}
+
+func beUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+//fracMicros 把 DATETIME2/TIME2/TIMESTAMP2 地 fsp 字节还原成微秒数
+func fracMicros(fsp int, b []byte) int64 {
+	frac := int64(beUint(b))
+	switch fsp {
+	case 1, 2:
+		frac *= 10000
+	case 3, 4:
+		frac *= 100
+	}
+	return frac
+}
+
+func fracBytes(fsp int) int {
+	return (fsp + 1) / 2
+}
+
+//decodeTimestamp2 解出 TIMESTAMP2：4 字节大端 unix 秒 + fsp 对应地小数秒字节
+func decodeTimestamp2(r io.Reader, fsp int) (time.Time, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return time.Time{}, err
+	}
+	sec := int64(binary.BigEndian.Uint32(b))
+
+	var frac int64
+	if n := fracBytes(fsp); n > 0 {
+		fb := make([]byte, n)
+		if _, err := io.ReadFull(r, fb); err != nil {
+			return time.Time{}, err
+		}
+		frac = fracMicros(fsp, fb)
+	}
+	return time.Unix(sec, 0).UTC().Add(time.Duration(frac) * time.Microsecond), nil
+}
+
+//decodeDatetime2 解出 DATETIME2：5 字节大端打包地 year/month/day/hour/minute/second + fsp 小数秒
+func decodeDatetime2(r io.Reader, fsp int) (string, error) {
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	intPart := int64(beUint(b)) - 0x8000000000
+
+	var frac int64
+	if n := fracBytes(fsp); n > 0 {
+		fb := make([]byte, n)
+		if _, err := io.ReadFull(r, fb); err != nil {
+			return "", err
+		}
+		frac = fracMicros(fsp, fb)
+	}
+
+	ymd := intPart >> 17
+	ym := ymd >> 5
+	day := ymd & 0x1f
+	month := ym % 13
+	year := ym / 13
+	hms := intPart & 0x1ffff
+	sec := hms & 0x3f
+	min := (hms >> 6) & 0x3f
+	hour := hms >> 12
+
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", year, month, day, hour, min, sec, frac), nil
+}
+
+//decodeTime2 解出 TIME2：3 字节大端打包地 sign/hour/minute/second + fsp 小数秒
+func decodeTime2(r io.Reader, fsp int) (string, error) {
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	intPart := int64(beUint(b)) - 0x800000
+
+	var frac int64
+	if n := fracBytes(fsp); n > 0 {
+		fb := make([]byte, n)
+		if _, err := io.ReadFull(r, fb); err != nil {
+			return "", err
+		}
+		frac = fracMicros(fsp, fb)
+	}
+
+	sign := ""
+	if intPart < 0 {
+		sign = "-"
+		intPart = -intPart
+	}
+	sec := intPart & 0x3f
+	min := (intPart >> 6) & 0x3f
+	hour := intPart >> 12
+
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, hour, min, sec, frac), nil
+}
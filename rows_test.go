@@ -0,0 +1,36 @@
+package binlog_parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeColumnValue(t *testing.T) {
+	cases := []struct {
+		name    string
+		colType byte
+		meta    []byte
+		input   []byte
+		want    interface{}
+	}{
+		{"tiny", MYSQL_TYPE_TINY, nil, []byte{0xfe}, int64(-2)},
+		{"short", MYSQL_TYPE_SHORT, nil, []byte{0x2c, 0x01}, int64(300)},
+		{"long", MYSQL_TYPE_LONG, nil, []byte{0x01, 0x00, 0x00, 0x00}, int64(1)},
+		{"varchar", MYSQL_TYPE_VARCHAR, []byte{0xff, 0x00}, []byte{3, 'a', 'b', 'c'}, "abc"},
+		{"newdecimal", MYSQL_TYPE_NEWDECIMAL, []byte{10, 2}, []byte{0x80, 0x00, 0x00, 0x7b, 0x1e}, "123.30"},
+		//CHAR(10): meta[0] 是 real_type(0xfe=MYSQL_TYPE_STRING)，meta[1] 是长度，大端顺序，和 VARCHAR 相反
+		{"string_char", MYSQL_TYPE_STRING, []byte{0xfe, 10}, []byte{'h', 'i', 0, 0, 0, 0, 0, 0, 0, 0}, "hi"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeColumnValue(bytes.NewReader(tc.input), tc.colType, tc.meta)
+			if err != nil {
+				t.Fatalf("decodeColumnValue: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}